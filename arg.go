@@ -0,0 +1,80 @@
+package redisqlite
+
+import (
+	"encoding/json"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ArgKind tags the SQLite storage class an Arg should bind as.
+type ArgKind int
+
+const (
+	// ArgText binds Arg.Text.
+	ArgText ArgKind = iota
+	// ArgInt binds Arg.Int.
+	ArgInt
+	// ArgReal binds Arg.Real.
+	ArgReal
+	// ArgBlob binds Arg.Bytes as a []byte, the same driver value a plain
+	// []byte argument binds as.
+	ArgBlob
+	// ArgNull binds SQL NULL.
+	ArgNull
+)
+
+// Arg is a typed argument for Exec/Query/Prep-bound statements. Most
+// callers can keep passing plain Go values (string, int64, float64, nil),
+// but binary data that must round-trip exactly - e.g. a UUID stored as
+// BLOB rather than TEXT - should be wrapped in an Arg{Kind: ArgBlob} so the
+// driver binds it as binary rather than whatever encoding/json or a
+// string conversion would otherwise produce.
+type Arg struct {
+	Kind  ArgKind
+	Text  string
+	Int   int64
+	Real  float64
+	Bytes []byte
+}
+
+// Value returns the driver-level Go value a matches, suitable for
+// database/sql's Exec/Query argument list.
+func (a Arg) Value() interface{} {
+	switch a.Kind {
+	case ArgInt:
+		return a.Int
+	case ArgReal:
+		return a.Real
+	case ArgBlob:
+		return a.Bytes
+	case ArgNull:
+		return nil
+	default:
+		return a.Text
+	}
+}
+
+// bindArgs resolves any Arg values in args to the driver-level value they
+// wrap, leaving already-plain arguments (string, int64, ...) untouched.
+func bindArgs(args []interface{}) []interface{} {
+	bound := make([]interface{}, len(args))
+	for i, a := range args {
+		if arg, ok := a.(Arg); ok {
+			bound[i] = arg.Value()
+		} else {
+			bound[i] = a
+		}
+	}
+	return bound
+}
+
+// encodeRecord serializes v (a result row, as a map or an array) as
+// MessagePack when asBinary is set, or JSON otherwise. MessagePack encodes
+// a []byte BLOB column as a binary value that round-trips exactly; JSON
+// has no binary type and would base64 it instead.
+func encodeRecord(v interface{}, asBinary bool) ([]byte, error) {
+	if asBinary {
+		return msgpack.Marshal(v)
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,51 @@
+package redisqlite
+
+import (
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestBindArgsResolvesArgValues(t *testing.T) {
+	args := []interface{}{
+		Arg{Kind: ArgBlob, Bytes: []byte{0, 1, 255}},
+		Arg{Kind: ArgNull},
+		"plain string",
+	}
+	bound := bindArgs(args)
+
+	blob, ok := bound[0].([]byte)
+	if !ok || len(blob) != 3 || blob[2] != 255 {
+		t.Fatalf("expected ArgBlob to bind to its raw bytes, got %#v", bound[0])
+	}
+	if bound[1] != nil {
+		t.Fatalf("expected ArgNull to bind to nil, got %#v", bound[1])
+	}
+	if bound[2] != "plain string" {
+		t.Fatalf("expected a plain argument to pass through unchanged, got %#v", bound[2])
+	}
+}
+
+// encodeRecord's whole reason to exist is that MessagePack round-trips a
+// []byte BLOB exactly, unlike JSON which base64-encodes it into a string.
+func TestEncodeRecordBinaryRoundTripsBlob(t *testing.T) {
+	blob := []byte{0, 1, 2, 255}
+	record := map[string]interface{}{"v": blob}
+
+	encoded, err := encodeRecord(record, true)
+	if err != nil {
+		t.Fatalf("encodeRecord: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := msgpack.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatalf("msgpack.Unmarshal: %v", err)
+	}
+	got, ok := decoded["v"].([]byte)
+	if !ok {
+		t.Fatalf("expected v to decode back to []byte, got %T", decoded["v"])
+	}
+	if string(got) != string(blob) {
+		t.Fatalf("got %v, want %v", got, blob)
+	}
+}
@@ -0,0 +1,247 @@
+//go:build !nosqlite3
+
+package redisqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// errBackupUnsupportedDriver is returned by Backup/Dump/Restore when the
+// currently open database isn't sqlite3, since they rely on go-sqlite3's
+// online backup API, or when it was opened through a RegisterHook-wrapped
+// driver name whose sqlhooks-wrapped connections don't expose the
+// underlying *sqlite3.SQLiteConn that API needs.
+var errBackupUnsupportedDriver = errors.New("redisqlite: Backup/Dump/Restore require the sqlite3 driver")
+
+// Backup writes a consistent online copy of the currently open database to
+// destPath, using SQLite's online backup API so it can run against a live
+// database without locking out writers for the whole copy.
+func Backup(destPath string) error {
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	if _, ok := dbDialect.(sqliteDialect); !ok {
+		return errBackupUnsupportedDriver
+	}
+
+	destDB, err := sql.Open("sqlite3", destPath)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	ctx := context.Background()
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	srcConn, err := rwDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return rawBackup(destConn, srcConn)
+}
+
+// rawBackup runs SQLite's online backup API from srcConn into destConn, via
+// (*sql.Conn).Raw to reach the underlying *sqlite3.SQLiteConn. Shared by
+// Backup (live database -> file) and restoreMemory (file -> live database,
+// the same API run in the opposite direction).
+func rawBackup(destConn, srcConn *sql.Conn) error {
+	return destConn.Raw(func(destDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			destSqliteConn, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errBackupUnsupportedDriver
+			}
+			srcSqliteConn, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errBackupUnsupportedDriver
+			}
+
+			backup, err := destSqliteConn.Backup("main", srcSqliteConn, "main")
+			if err != nil {
+				return err
+			}
+			defer backup.Close()
+
+			if _, err := backup.Step(-1); err != nil {
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// Dump writes a consistent online backup of the currently open database to
+// w, via a temporary file backed by Backup's online backup API.
+func Dump(w io.Writer) error {
+	tmp, err := os.CreateTemp("", "redisqlite-dump-*.db")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	if err := Backup(tmpPath); err != nil {
+		return err
+	}
+
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// Restore replaces the currently open database with the contents of
+// srcPath. Every prepared statement is invalidated (the caller must Prep
+// again). For a file database the connections are closed and reopened around
+// the swap; an in-memory database is restored in place (see restoreMemory).
+func Restore(srcPath string) error {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+
+	if _, ok := dbDialect.(sqliteDialect); !ok {
+		return errBackupUnsupportedDriver
+	}
+
+	resetPrepCache()
+
+	if currentConfig.Memory {
+		return restoreMemory(srcPath)
+	}
+
+	rwDB.Close()
+	roDB.Close()
+
+	destPath := sqliteFilePath(currentDSN)
+	if err := replaceFile(srcPath, destPath); err != nil {
+		return err
+	}
+
+	// openLocked, not Open: dbMutex is already held for write here, and
+	// sync.RWMutex isn't reentrant.
+	return openLocked(currentConfig)
+}
+
+// restoreMemory restores srcPath into the live shared-cache in-memory
+// database in place, running the online backup API in the opposite
+// direction from Backup (file -> live database). The normal close-and-
+// reopen path Restore otherwise uses would discard a shared-cache
+// in-memory database instead of restoring it: it's dropped the moment its
+// last connection (rwDB's single pinned one) closes, and the next Open
+// would just create a fresh, empty one.
+func restoreMemory(srcPath string) error {
+	srcDB, err := sql.Open("sqlite3", srcPath+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer srcDB.Close()
+
+	ctx := context.Background()
+	srcConn, err := srcDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	destConn, err := rwDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+
+	return rawBackup(destConn, srcConn)
+}
+
+// sqliteFilePath strips DSN query parameters (e.g. "?mode=ro") leaving the
+// bare file path sqlite3 opens.
+func sqliteFilePath(dsn string) string {
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		return dsn[:i]
+	}
+	return dsn
+}
+
+// replaceFile copies srcPath over destPath via a temp file plus rename, so
+// a reader never observes a partially-written destPath.
+func replaceFile(srcPath, destPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := destPath + ".restore-tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, destPath)
+}
+
+// periodicDumpCancel stops the periodic dump goroutine started by the most
+// recent Open, if any, so a later Open (e.g. from Restore) doesn't leave the
+// previous one running forever alongside the new one.
+var periodicDumpCancel context.CancelFunc
+
+// stopPeriodicDump cancels the currently running periodic dump goroutine, if
+// any. Safe to call even when none is running.
+func stopPeriodicDump() {
+	if periodicDumpCancel != nil {
+		periodicDumpCancel()
+		periodicDumpCancel = nil
+	}
+}
+
+// startPeriodicDump writes a fresh dump to path every interval, in the
+// background, until the goroutine it starts is cancelled by a later
+// stopPeriodicDump call. Errors are dropped; there's no logging facility for
+// a background task to report to yet.
+func startPeriodicDump(interval time.Duration, path string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	periodicDumpCancel = cancel
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				f, err := os.Create(path)
+				if err != nil {
+					continue
+				}
+				_ = Dump(f)
+				f.Close()
+			}
+		}
+	}()
+}
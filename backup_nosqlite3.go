@@ -0,0 +1,35 @@
+//go:build nosqlite3
+
+package redisqlite
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// errBackupUnsupportedDriver is returned by Backup/Dump/Restore in builds
+// without the sqlite3 driver linked in, since they rely on go-sqlite3's
+// online backup API.
+var errBackupUnsupportedDriver = errors.New("redisqlite: Backup/Dump/Restore require building without the nosqlite3 tag")
+
+// Backup is unavailable in builds tagged nosqlite3.
+func Backup(destPath string) error {
+	return errBackupUnsupportedDriver
+}
+
+// Dump is unavailable in builds tagged nosqlite3.
+func Dump(w io.Writer) error {
+	return errBackupUnsupportedDriver
+}
+
+// Restore is unavailable in builds tagged nosqlite3.
+func Restore(srcPath string) error {
+	return errBackupUnsupportedDriver
+}
+
+// startPeriodicDump is a no-op in builds tagged nosqlite3.
+func startPeriodicDump(interval time.Duration, path string) {}
+
+// stopPeriodicDump is a no-op in builds tagged nosqlite3.
+func stopPeriodicDump() {}
@@ -0,0 +1,69 @@
+package redisqlite
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// Backup/Dump/Restore must round-trip a database: restoring a backup taken
+// after the dump brings back both inserted rows.
+func TestBackupDumpRestoreRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	if err := Open(Config{DSN: filepath.Join(dir, "orig.db")}); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, _, err := Exec("CREATE TABLE backup_test_t (id INTEGER PRIMARY KEY, v TEXT)", nil); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	if _, _, err := Exec("INSERT INTO backup_test_t (v) VALUES ('hello')", nil); err != nil {
+		t.Fatalf("insert: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := Dump(&buf); err != nil {
+		t.Fatalf("Dump: %v", err)
+	}
+	if buf.Len() == 0 {
+		t.Fatalf("expected a non-empty dump")
+	}
+
+	if _, _, err := Exec("INSERT INTO backup_test_t (v) VALUES ('after-dump')", nil); err != nil {
+		t.Fatalf("insert after dump: %v", err)
+	}
+
+	dumpPath := filepath.Join(dir, "dump.db")
+	if err := Backup(dumpPath); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if err := Restore(dumpPath); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	res, err := Query("SELECT v FROM backup_test_t ORDER BY id", nil, false, 0, false)
+	if err != nil {
+		t.Fatalf("query after restore: %v", err)
+	}
+	if len(res) != 2 {
+		t.Fatalf("expected 2 rows after restoring the post-dump backup, got %d: %v", len(res), res)
+	}
+}
+
+// Backup must report errBackupUnsupportedDriver, not panic, when the open
+// database's driver conn isn't a *sqlite3.SQLiteConn - the case when it was
+// opened through a RegisterHook-wrapped driver name.
+func TestBackupUnsupportedDriverDoesNotPanic(t *testing.T) {
+	rec := &slowQueryLogger{}
+	name, err := RegisterHook("sqlite3", rec)
+	if err != nil {
+		t.Fatalf("RegisterHook: %v", err)
+	}
+	if err := Open(Config{Driver: name, Memory: true}); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	err = Backup(filepath.Join(t.TempDir(), "dest.db"))
+	if err != errBackupUnsupportedDriver {
+		t.Fatalf("expected errBackupUnsupportedDriver, got %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package redisqlite
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrLastInsertIdUnsupported is returned in place of a last-insert id by
+// dialects whose driver has no such concept (e.g. PostgreSQL, where callers
+// should use a RETURNING clause instead).
+var ErrLastInsertIdUnsupported = errors.New("redisqlite: driver does not support LastInsertId")
+
+// dialect isolates the handful of places where SQL semantics differ across
+// the backends Open can target.
+type dialect interface {
+	// lastInsertId extracts the last inserted row id from res, or returns
+	// ErrLastInsertIdUnsupported if the backend doesn't support it.
+	lastInsertId(res sql.Result) (int64, error)
+	// roDSN adapts a read-write DSN into one suitable for the read-only
+	// pool. Backends without a notion of a read-only connection mode
+	// return dsn unchanged.
+	roDSN(dsn string) string
+	// quoteIdent quotes name (already validated against identifierPattern
+	// by parseFilter) as a column reference in the filter DSL's generated
+	// WHERE clause, in whatever style the backend's default SQL mode
+	// expects.
+	quoteIdent(name string) string
+}
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) lastInsertId(res sql.Result) (int64, error) {
+	return res.LastInsertId()
+}
+
+func (sqliteDialect) roDSN(dsn string) string {
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + "mode=ro&_journal=WAL"
+}
+
+func (sqliteDialect) quoteIdent(name string) string {
+	return `"` + name + `"`
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) lastInsertId(res sql.Result) (int64, error) {
+	return 0, ErrLastInsertIdUnsupported
+}
+
+func (postgresDialect) roDSN(dsn string) string {
+	return dsn
+}
+
+func (postgresDialect) quoteIdent(name string) string {
+	return `"` + name + `"`
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) lastInsertId(res sql.Result) (int64, error) {
+	return res.LastInsertId()
+}
+
+func (mysqlDialect) roDSN(dsn string) string {
+	return dsn
+}
+
+// MySQL without ANSI_QUOTES parses a double-quoted string as a string
+// literal, not an identifier, so a filter column has to be backtick-quoted
+// to be recognized as a column reference rather than a constant.
+func (mysqlDialect) quoteIdent(name string) string {
+	return "`" + name + "`"
+}
+
+// dialectFor returns the dialect matching a database/sql driver name,
+// defaulting to sqliteDialect for an empty or unrecognized driver. Prefix
+// matching (rather than equality) lets it also recognize the generated
+// names RegisterHook registers, e.g. "postgres-hook-a1b2c3".
+func dialectFor(driver string) dialect {
+	switch {
+	case strings.HasPrefix(driver, "postgres"):
+		return postgresDialect{}
+	case strings.HasPrefix(driver, "mysql"):
+		return mysqlDialect{}
+	default:
+		return sqliteDialect{}
+	}
+}
+
+// rawDriverFactories holds a constructor per un-hooked database/sql driver
+// name, populated by each driver_*.go file's init so RegisterHook can wrap
+// the real driver.Driver regardless of which build tags are enabled.
+var rawDriverFactories = struct {
+	mu sync.Mutex
+	m  map[string]func() driver.Driver
+}{m: make(map[string]func() driver.Driver)}
+
+func registerRawDriver(name string, factory func() driver.Driver) {
+	rawDriverFactories.mu.Lock()
+	defer rawDriverFactories.mu.Unlock()
+	rawDriverFactories.m[name] = factory
+}
+
+func rawDriver(name string) (driver.Driver, bool) {
+	rawDriverFactories.mu.Lock()
+	factory, ok := rawDriverFactories.m[name]
+	rawDriverFactories.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	return factory(), true
+}
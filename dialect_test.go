@@ -0,0 +1,26 @@
+package redisqlite
+
+import "testing"
+
+// dialectFor matches driver names by prefix, not equality, so it also
+// recognizes the generated names RegisterHook registers
+// (e.g. "postgres-hook-a1b2c3").
+func TestDialectForMatchesHookedDriverNames(t *testing.T) {
+	cases := []struct {
+		driver string
+		want   dialect
+	}{
+		{"sqlite3", sqliteDialect{}},
+		{"postgres", postgresDialect{}},
+		{"postgres-hook-a1b2c3", postgresDialect{}},
+		{"mysql", mysqlDialect{}},
+		{"mysql-hook-a1b2c3", mysqlDialect{}},
+		{"", sqliteDialect{}},
+		{"unknown", sqliteDialect{}},
+	}
+	for _, c := range cases {
+		if got := dialectFor(c.driver); got != c.want {
+			t.Errorf("dialectFor(%q) = %#v, want %#v", c.driver, got, c.want)
+		}
+	}
+}
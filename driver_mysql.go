@@ -0,0 +1,13 @@
+//go:build mysql
+
+package redisqlite
+
+import (
+	"database/sql/driver"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func init() {
+	registerRawDriver("mysql", func() driver.Driver { return &mysql.MySQLDriver{} })
+}
@@ -0,0 +1,13 @@
+//go:build postgres
+
+package redisqlite
+
+import (
+	"database/sql/driver"
+
+	"github.com/lib/pq"
+)
+
+func init() {
+	registerRawDriver("postgres", func() driver.Driver { return &pq.Driver{} })
+}
@@ -0,0 +1,13 @@
+//go:build !nosqlite3
+
+package redisqlite
+
+import (
+	"database/sql/driver"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	registerRawDriver("sqlite3", func() driver.Driver { return &sqlite3.SQLiteDriver{} })
+}
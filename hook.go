@@ -0,0 +1,224 @@
+package redisqlite
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"expvar"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/qustavo/sqlhooks/v2"
+)
+
+// Stats exposes redisqlite's operation counters and latency histograms
+// under expvar (e.g. served at /debug/vars), following the same pattern
+// rqlite uses for its stats map.
+var Stats = expvar.NewMap("redisqlite")
+
+var execLatency = newLatencyHistogram()
+var queryLatency = newLatencyHistogram()
+
+func init() {
+	Stats.Set("exec_latency", execLatency)
+	Stats.Set("query_latency", queryLatency)
+}
+
+// Hook lets an operator observe every Exec/Query/Prepare that flows
+// through the package, e.g. to log slow queries. args are already resolved
+// from any Arg wrappers to their driver-level values.
+type Hook interface {
+	BeforeExec(query string, args []interface{})
+	AfterExec(query string, args []interface{}, dur time.Duration, err error)
+	BeforeQuery(query string, args []interface{})
+	AfterQuery(query string, args []interface{}, dur time.Duration, err error)
+	BeforePrepare(query string)
+	AfterPrepare(query string, dur time.Duration, err error)
+}
+
+// activeHook is the Hook belonging to the driver Open last connected with,
+// if any, used to instrument Prep (which never goes through the
+// database/sql driver machinery sqlhooks wraps).
+var activeHook Hook
+
+// hookRegistry remembers which Hook a RegisterHook-generated driver name
+// wraps, so Open can find it again by name.
+var hookRegistry = struct {
+	mu sync.Mutex
+	m  map[string]Hook
+}{m: make(map[string]Hook)}
+
+// RegisterHook wraps driverName's real database/sql/driver.Driver (e.g.
+// "sqlite3") with hook and registers the wrapped driver under a freshly
+// generated name, using sqlhooks (the same approach GoBlog uses). Pass the
+// returned name as Config.Driver to Open. Each call mints its own driver
+// name, so separate Open calls with different hooks never collide on the
+// same registration - sql.Register panics if called twice with one name.
+func RegisterHook(driverName string, hook Hook) (string, error) {
+	raw, ok := rawDriver(driverName)
+	if !ok {
+		return "", fmt.Errorf("redisqlite: unknown driver %q", driverName)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	name := driverName + "-hook-" + hex.EncodeToString(suffix)
+
+	sql.Register(name, sqlhooks.Wrap(raw, &hookAdapter{hook: hook}))
+
+	hookRegistry.mu.Lock()
+	hookRegistry.m[name] = hook
+	hookRegistry.mu.Unlock()
+
+	return name, nil
+}
+
+// hookAdapter implements sqlhooks.Hooks, dispatching to a Hook. sqlhooks
+// doesn't distinguish Exec from Query in its Before/After signature, so
+// isSelect classifies the statement the same way Prep does when choosing a
+// pool.
+type hookAdapter struct {
+	hook Hook
+}
+
+type hookStartKey struct{}
+
+func (h *hookAdapter) Before(ctx context.Context, query string, args ...interface{}) (context.Context, error) {
+	if isSelect(query) {
+		h.hook.BeforeQuery(query, args)
+	} else {
+		h.hook.BeforeExec(query, args)
+	}
+	return context.WithValue(ctx, hookStartKey{}, time.Now()), nil
+}
+
+func (h *hookAdapter) After(ctx context.Context, query string, args ...interface{}) (context.Context, error) {
+	dur := hookDuration(ctx)
+	if isSelect(query) {
+		h.hook.AfterQuery(query, args, dur, nil)
+	} else {
+		h.hook.AfterExec(query, args, dur, nil)
+	}
+	return ctx, nil
+}
+
+func (h *hookAdapter) OnError(ctx context.Context, err error, query string, args ...interface{}) error {
+	dur := hookDuration(ctx)
+	if isSelect(query) {
+		h.hook.AfterQuery(query, args, dur, err)
+	} else {
+		h.hook.AfterExec(query, args, dur, err)
+	}
+	return err
+}
+
+// recordExec and recordQuery update the exec_ok/exec_err and
+// query_ok/query_err counters and latency histograms from Exec and Query
+// directly, so they're populated for every call regardless of whether a
+// Hook is registered via RegisterHook - unlike the Hook interface itself,
+// which only ever sees traffic on a hook-wrapped driver.
+func recordExec(dur time.Duration, err error) {
+	execLatency.observe(dur)
+	if err != nil {
+		Stats.Add("exec_err", 1)
+	} else {
+		Stats.Add("exec_ok", 1)
+	}
+}
+
+func recordQuery(dur time.Duration, err error) {
+	queryLatency.observe(dur)
+	if err != nil {
+		Stats.Add("query_err", 1)
+	} else {
+		Stats.Add("query_ok", 1)
+	}
+}
+
+func hookDuration(ctx context.Context) time.Duration {
+	start, _ := ctx.Value(hookStartKey{}).(time.Time)
+	if start.IsZero() {
+		return 0
+	}
+	return time.Since(start)
+}
+
+// NewSlowQueryLogger returns a Hook that logs, via the standard log
+// package, any Exec/Query/Prepare taking at least threshold, with bound
+// arguments redacted since they may carry sensitive data.
+func NewSlowQueryLogger(threshold time.Duration) Hook {
+	return &slowQueryLogger{threshold: threshold}
+}
+
+type slowQueryLogger struct {
+	threshold time.Duration
+}
+
+func (l *slowQueryLogger) BeforeExec(query string, args []interface{})  {}
+func (l *slowQueryLogger) BeforeQuery(query string, args []interface{}) {}
+func (l *slowQueryLogger) BeforePrepare(query string)                   {}
+
+func (l *slowQueryLogger) AfterExec(query string, args []interface{}, dur time.Duration, err error) {
+	l.logIfSlow("exec", query, len(args), dur)
+}
+
+func (l *slowQueryLogger) AfterQuery(query string, args []interface{}, dur time.Duration, err error) {
+	l.logIfSlow("query", query, len(args), dur)
+}
+
+func (l *slowQueryLogger) AfterPrepare(query string, dur time.Duration, err error) {
+	l.logIfSlow("prepare", query, 0, dur)
+}
+
+func (l *slowQueryLogger) logIfSlow(kind, query string, nargs int, dur time.Duration) {
+	if dur < l.threshold {
+		return
+	}
+	log.Printf("redisqlite: slow %s (%s, %d args redacted): %s", kind, dur, nargs, query)
+}
+
+// latencyHistogram is a minimal latency histogram published via expvar:
+// bucket counts keyed by their upper bound, plus an overflow bucket.
+type latencyHistogram struct {
+	mu      sync.Mutex
+	buckets []time.Duration
+	counts  []int64
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{
+		buckets: []time.Duration{time.Millisecond, 10 * time.Millisecond, 100 * time.Millisecond, time.Second},
+		counts:  make([]int64, 5),
+	}
+}
+
+func (h *latencyHistogram) observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.buckets {
+		if d <= b {
+			h.counts[i]++
+			return
+		}
+	}
+	h.counts[len(h.counts)-1]++
+}
+
+// String implements expvar.Var.
+func (h *latencyHistogram) String() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	parts := make([]string, 0, len(h.counts))
+	for i, b := range h.buckets {
+		parts = append(parts, fmt.Sprintf("%q:%d", b, h.counts[i]))
+	}
+	parts = append(parts, fmt.Sprintf("%q:%d", "inf", h.counts[len(h.counts)-1]))
+	return "{" + strings.Join(parts, ",") + "}"
+}
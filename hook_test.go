@@ -0,0 +1,41 @@
+package redisqlite
+
+import (
+	"expvar"
+	"testing"
+)
+
+// varString stringifies an expvar.Var, treating an unset counter (nil, for
+// a key that's never been incremented) as "0".
+func varString(v expvar.Var) string {
+	if v == nil {
+		return "0"
+	}
+	return v.String()
+}
+
+// exec_ok/query_ok must be populated by plain Exec/Query calls even when no
+// Hook has been registered via RegisterHook, since that's the common case
+// and the counters are documented as general-purpose instrumentation, not
+// something gated behind opting into slow-query logging.
+func TestInstrumentationCountersWithoutHook(t *testing.T) {
+	if err := Open(Config{Memory: true}); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	before := varString(Stats.Get("exec_ok"))
+	if _, _, err := Exec("CREATE TABLE IF NOT EXISTS hook_test_t (id INTEGER PRIMARY KEY, v TEXT)", nil); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if after := varString(Stats.Get("exec_ok")); after == before {
+		t.Fatalf("expected exec_ok to change, stayed at %s", after)
+	}
+
+	beforeQ := varString(Stats.Get("query_ok"))
+	if _, err := Query("SELECT * FROM hook_test_t", nil, true, 0, false); err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if after := varString(Stats.Get("query_ok")); after == beforeQ {
+		t.Fatalf("expected query_ok to change, stayed at %s", after)
+	}
+}
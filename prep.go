@@ -0,0 +1,190 @@
+package redisqlite
+
+import (
+	"container/list"
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// PREP_MAX_SIZE caps how many distinct prepared statements are kept live at
+// once. Once the cache is full, Prep evicts the least recently used
+// statement instead of erroring.
+const PREP_MAX_SIZE = 10000
+
+// preparedStmt is a prep_cache entry: the compiled statement, which pool it
+// was prepared against, the SQL it was compiled from (so it can be found in
+// prep_by_text again on eviction), and its node in the prep_lru list.
+type preparedStmt struct {
+	stmt    *sql.Stmt
+	isQuery bool
+	text    string
+	elem    *list.Element
+}
+
+// prep_mutex guards prep_cache, prep_by_text and prep_lru, since Exec and
+// Query may race against each other and against Prep from other goroutines.
+var prep_mutex sync.RWMutex
+var prep_index uint64 = 1
+var prep_cache = make(map[uint64]*preparedStmt) // index -> entry
+var prep_by_text = make(map[string]uint64)      // sql text -> index, for Prep(sameSQL) dedup
+var prep_lru = list.New()                       // Front() is most recently used
+
+// prep_group collapses concurrent first-time Prep calls for identical SQL
+// into a single db.Prepare.
+var prep_group singleflight.Group
+
+// resetPrepCache discards every cached prepared statement without closing
+// the underlying *sql.DB pools, used by Open and Restore.
+func resetPrepCache() {
+	prep_mutex.Lock()
+	defer prep_mutex.Unlock()
+
+	for _, prepared := range prep_cache {
+		prepared.stmt.Close()
+	}
+	prep_cache = make(map[uint64]*preparedStmt)
+	prep_by_text = make(map[string]uint64)
+	prep_lru = list.New()
+}
+
+// lookupPrep returns the cached statement for index, bumping its LRU
+// recency, or ok=false if nothing is cached under that index.
+func lookupPrep(index uint64) (prepared *preparedStmt, ok bool) {
+	prep_mutex.Lock()
+	defer prep_mutex.Unlock()
+
+	prepared, ok = prep_cache[index]
+	if ok {
+		prep_lru.MoveToFront(prepared.elem)
+	}
+	return prepared, ok
+}
+
+// Prep prepares a sql statement and stores it in a table returning a
+// number. It also accepts a number, and if it corresponds to the number
+// returned by a previous statement, it closes the prepared statement.
+// Repeated calls with the same SQL text return the same index rather than
+// compiling it again; the cache holds up to PREP_MAX_SIZE distinct
+// statements, evicting the least recently used once it is full.
+// Using the special statement "clean_prep_cache" you can close all the
+// opened statements. Returned 0 means OK, any other number is the index in
+// the cache.
+// Whether queryOrNumber reads as a SELECT decides which pool (rwDB or roDB)
+// the statement is prepared against, so Exec/Query dispatch transparently.
+func Prep(queryOrNumber string) (uint64, error) {
+
+	if queryOrNumber == "clean_prep_cache" {
+		resetPrepCache()
+		return 0, nil
+	}
+
+	if index, err := strconv.ParseUint(queryOrNumber, 10, 64); err == nil {
+		prep_mutex.Lock()
+		prepared, ok := prep_cache[index]
+		if !ok {
+			prep_mutex.Unlock()
+			return 0, errors.New("invalid prepared statement index")
+		}
+		evictPrepLocked(index, prepared)
+		prep_mutex.Unlock()
+		return 0, nil
+	}
+
+	if index, ok := lookupPrepByText(queryOrNumber); ok {
+		return index, nil
+	}
+
+	if activeHook != nil {
+		activeHook.BeforePrepare(queryOrNumber)
+	}
+	start := time.Now()
+
+	result, err, _ := prep_group.Do(queryOrNumber, func() (interface{}, error) {
+		// another goroutine may have compiled it while we waited for
+		// the group
+		if index, ok := lookupPrepByText(queryOrNumber); ok {
+			return index, nil
+		}
+
+		isQuery := isSelect(queryOrNumber)
+		dbMutex.RLock()
+		pool := rwDB
+		if isQuery {
+			pool = roDB
+		}
+		stmt, err := pool.Prepare(queryOrNumber)
+		dbMutex.RUnlock()
+		if err != nil {
+			return uint64(0), err
+		}
+
+		prep_mutex.Lock()
+		defer prep_mutex.Unlock()
+
+		// get next index, handling the unlikely case of overflow
+		prep_index = prep_index + 1
+		if prep_index == 0 {
+			prep_index = 1
+		}
+		index := prep_index
+
+		prepared := &preparedStmt{stmt: stmt, isQuery: isQuery, text: queryOrNumber}
+		prepared.elem = prep_lru.PushFront(index)
+		prep_cache[index] = prepared
+		prep_by_text[queryOrNumber] = index
+		Stats.Add("prep_ok", 1)
+
+		evictOverflowLocked()
+
+		return index, nil
+	})
+
+	if activeHook != nil {
+		activeHook.AfterPrepare(queryOrNumber, time.Since(start), err)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.(uint64), nil
+}
+
+// lookupPrepByText returns the index of an already-cached statement for
+// sqlText, bumping its LRU recency.
+func lookupPrepByText(sqlText string) (uint64, bool) {
+	prep_mutex.Lock()
+	defer prep_mutex.Unlock()
+
+	index, ok := prep_by_text[sqlText]
+	if ok {
+		prep_lru.MoveToFront(prep_cache[index].elem)
+	}
+	return index, ok
+}
+
+// evictOverflowLocked evicts least-recently-used statements until the
+// cache is back at or under PREP_MAX_SIZE. Callers must hold prep_mutex.
+func evictOverflowLocked() {
+	for len(prep_cache) > PREP_MAX_SIZE {
+		back := prep_lru.Back()
+		if back == nil {
+			return
+		}
+		index := back.Value.(uint64)
+		evictPrepLocked(index, prep_cache[index])
+		Stats.Add("prep_evictions", 1)
+	}
+}
+
+// evictPrepLocked removes index from every cache structure and closes its
+// statement. Callers must hold prep_mutex.
+func evictPrepLocked(index uint64, prepared *preparedStmt) {
+	prep_lru.Remove(prepared.elem)
+	delete(prep_cache, index)
+	delete(prep_by_text, prepared.text)
+	prepared.stmt.Close()
+}
@@ -0,0 +1,60 @@
+package redisqlite
+
+import (
+	"strconv"
+	"testing"
+)
+
+// Prep must dedup repeated calls with the same SQL text against the same
+// cache entry, and evicting that index must clear both lookup paths
+// (prep_cache and prep_by_text) so a later Prep recompiles instead of
+// reusing a stale, now-closed statement.
+func TestPrepDedupAndEviction(t *testing.T) {
+	if err := Open(Config{Memory: true}); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, _, err := Exec("CREATE TABLE prep_test_t (id INTEGER PRIMARY KEY, v TEXT)", nil); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+
+	const sql = "INSERT INTO prep_test_t (v) VALUES (?)"
+	idx1, err := Prep(sql)
+	if err != nil {
+		t.Fatalf("Prep: %v", err)
+	}
+	idx2, err := Prep(sql)
+	if err != nil {
+		t.Fatalf("Prep (dedup): %v", err)
+	}
+	if idx1 != idx2 {
+		t.Fatalf("expected repeated Prep of identical SQL to dedup, got %d != %d", idx1, idx2)
+	}
+
+	if _, ok := lookupPrepByText(sql); !ok {
+		t.Fatalf("expected %q to be cached by text", sql)
+	}
+
+	// "Prep(index)" evicts that entry.
+	zero, err := Prep(strconv.FormatUint(idx1, 10))
+	if err != nil {
+		t.Fatalf("Prep(index) evict: %v", err)
+	}
+	if zero != 0 {
+		t.Fatalf("expected eviction to return 0, got %d", zero)
+	}
+
+	if _, ok := lookupPrep(idx1); ok {
+		t.Fatalf("expected index %d to be evicted from prep_cache", idx1)
+	}
+	if _, ok := lookupPrepByText(sql); ok {
+		t.Fatalf("expected %q to be evicted from prep_by_text", sql)
+	}
+
+	idx3, err := Prep(sql)
+	if err != nil {
+		t.Fatalf("Prep after eviction: %v", err)
+	}
+	if idx3 == idx1 {
+		t.Fatalf("expected a fresh index after eviction, got the same %d", idx3)
+	}
+}
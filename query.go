@@ -0,0 +1,225 @@
+package redisqlite
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// filterOp is a comparison operator recognized by parseFilter.
+type filterOp string
+
+const (
+	opEq filterOp = ":"
+	opGe filterOp = ">="
+	opLe filterOp = "<="
+	opNe filterOp = "!="
+	opGt filterOp = ">"
+	opLt filterOp = "<"
+)
+
+// filterCond is one parsed term of a filter expression, e.g. "-col:value"
+// becomes {Column: "col", Op: opEq, Value: "value", Negate: true}.
+type filterCond struct {
+	Column string
+	Op     filterOp
+	Value  string
+	Negate bool
+}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseFilter parses a small query/filter DSL of whitespace-separated
+// terms, e.g. `col:value col>10 -col:value`, inspired by the filter
+// language in golang.org/x/perf's storage query package, into a list of
+// conditions that are ANDed together.
+func parseFilter(filter string) ([]filterCond, error) {
+	var conds []filterCond
+	for _, term := range strings.Fields(filter) {
+		negate := false
+		if strings.HasPrefix(term, "-") {
+			negate = true
+			term = term[1:]
+		}
+
+		op, idx := findOp(term)
+		if idx <= 0 {
+			return nil, fmt.Errorf("redisqlite: invalid filter term %q", term)
+		}
+
+		column := term[:idx]
+		if !identifierPattern.MatchString(column) {
+			return nil, fmt.Errorf("redisqlite: invalid filter column %q", column)
+		}
+
+		conds = append(conds, filterCond{
+			Column: column,
+			Op:     filterOp(op),
+			Value:  term[idx+len(op):],
+			Negate: negate,
+		})
+	}
+	return conds, nil
+}
+
+// findOp returns the earliest recognized operator in term, scanning
+// left-to-right, and its index, or ("", -1) if none is found. A value
+// containing an operator character (e.g. "time>12:00") must not make a
+// later operator shadow an earlier one, so every candidate is checked at
+// each byte index rather than searching for operators in a fixed
+// preference order over the whole string; ">=" and "<=" are preferred over
+// their single-character prefix at the same index.
+func findOp(term string) (string, int) {
+	for i := 0; i < len(term); i++ {
+		switch {
+		case strings.HasPrefix(term[i:], ">="):
+			return ">=", i
+		case strings.HasPrefix(term[i:], "<="):
+			return "<=", i
+		case strings.HasPrefix(term[i:], "!="):
+			return "!=", i
+		case term[i] == ':', term[i] == '>', term[i] == '<':
+			return string(term[i]), i
+		}
+	}
+	return "", -1
+}
+
+// sqlCondition renders c as a parameterized SQL fragment plus its bound
+// value, quoting the column per d (see dialect.quoteIdent). The placeholder
+// is always "?", which lib/pq (postgres) does not accept. The column
+// name is validated by parseFilter before this is called, so it's safe to
+// splice directly into the fragment.
+func (c filterCond) sqlCondition(d dialect) (string, interface{}) {
+	op := "="
+	switch c.Op {
+	case opGt:
+		op = ">"
+	case opLt:
+		op = "<"
+	case opGe:
+		op = ">="
+	case opLe:
+		op = "<="
+	case opNe:
+		op = "!="
+	}
+
+	frag := fmt.Sprintf("%s %s ?", d.quoteIdent(c.Column), op)
+	if c.Negate {
+		frag = "NOT (" + frag + ")"
+	}
+	return frag, c.Value
+}
+
+// queryCursor is the opaque state QueryStructured returns when count
+// truncates the result set, so a client can resume from where it left off.
+// It's a plain OFFSET, not a rowid-keyset cursor: baseQuery is an arbitrary
+// caller-supplied SELECT with no guaranteed rowid column to key off, so
+// callers that need stable paging should give baseQuery its own ORDER BY.
+type queryCursor struct {
+	Offset int64 `json:"o"`
+}
+
+func encodeCursor(c queryCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.URLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(token string) (queryCursor, error) {
+	var c queryCursor
+	if token == "" {
+		return c, nil
+	}
+	raw, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return c, errors.New("redisqlite: invalid cursor")
+	}
+	if err := json.Unmarshal(raw, &c); err != nil {
+		return c, errors.New("redisqlite: invalid cursor")
+	}
+	return c, nil
+}
+
+// QueryStructured runs baseQuery, an arbitrary SELECT (not a prepared
+// statement index), filtered server-side by filter: a DSL of
+// whitespace-separated terms (col:value, col>N, col<=N, -col:value, ...)
+// ANDed together and layered as a WHERE clause over a subselect of
+// baseQuery. This lets a client that doesn't want to compose SQL still
+// filter results. The filter selects rows only: every column of baseQuery is
+// returned, and the DSL has no projection.
+//
+// It returns up to count rows (0 for everything) plus a cursor to resume
+// from when more rows remain; pass a previous call's cursor back in via the
+// cursor argument to page through the rest, rather than the caller having
+// no way to retrieve rows count dropped silently.
+// an argument may be a plain Go value or an Arg, for binary-safe binding;
+// asBinary selects MessagePack instead of JSON result encoding, same as Query.
+func QueryStructured(baseQuery string, filter string, args []interface{}, asMap bool, count int64, cursor string, asBinary bool) (res []string, nextCursor string, err error) {
+	conds, err := parseFilter(filter)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cur, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
+	queryArgs := append([]interface{}{}, bindArgs(args)...)
+	var where []string
+	for _, c := range conds {
+		frag, value := c.sqlCondition(dbDialect)
+		where = append(where, frag)
+		queryArgs = append(queryArgs, value)
+	}
+
+	sqlText := fmt.Sprintf("SELECT * FROM (%s) AS redisqlite_filtered", baseQuery)
+	if len(where) > 0 {
+		sqlText += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	// Fetch one row beyond count so we know whether there's a next page
+	// without a second round trip.
+	fetchLimit := count
+	if fetchLimit > 0 {
+		fetchLimit++
+	}
+	if cur.Offset > 0 {
+		// SQLite (and MySQL) reject a bare OFFSET with no LIMIT, so a
+		// resumed "count<=0: everything from here on" call needs an
+		// explicit "no limit" rather than omitting LIMIT entirely. -1 is
+		// SQLite's "no limit"; MySQL and PostgreSQL reject a negative
+		// LIMIT, so this resumed case runs on sqlite3 only.
+		if fetchLimit <= 0 {
+			fetchLimit = -1
+		}
+		sqlText += fmt.Sprintf(" LIMIT %d OFFSET %d", fetchLimit, cur.Offset)
+	} else if fetchLimit > 0 {
+		sqlText += fmt.Sprintf(" LIMIT %d", fetchLimit)
+	}
+
+	rows, err := roDB.Query(sqlText, queryArgs...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	out, err := scanRows(rows, asMap, 0, asBinary)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if count > 0 && int64(len(out)) > count {
+		out = out[:count]
+		nextCursor = encodeCursor(queryCursor{Offset: cur.Offset + count})
+	}
+
+	return out, nextCursor, nil
+}
@@ -0,0 +1,70 @@
+package redisqlite
+
+import "testing"
+
+// findOp must scan left-to-right for the earliest operator rather than
+// checking candidates in a fixed preference order over the whole term, or a
+// value containing an operator character (e.g. a ":" inside a time value)
+// shadows the real, earlier operator.
+func TestFindOpEarliestNotPreferred(t *testing.T) {
+	cases := []struct {
+		term    string
+		wantOp  string
+		wantIdx int
+	}{
+		{"col:value", ":", 3},
+		{"time>12:00", ">", 4},
+		{"time<=12:00", "<=", 4},
+		{"col!=x", "!=", 3},
+		{"noop", "", -1},
+	}
+	for _, c := range cases {
+		op, idx := findOp(c.term)
+		if op != c.wantOp || idx != c.wantIdx {
+			t.Errorf("findOp(%q) = (%q, %d), want (%q, %d)", c.term, op, idx, c.wantOp, c.wantIdx)
+		}
+	}
+}
+
+func TestParseFilterOperatorInValue(t *testing.T) {
+	conds, err := parseFilter("time>12:00")
+	if err != nil {
+		t.Fatalf("parseFilter: %v", err)
+	}
+	if len(conds) != 1 || conds[0].Column != "time" || conds[0].Op != opGt || conds[0].Value != "12:00" {
+		t.Fatalf("got %+v", conds)
+	}
+}
+
+// QueryStructured must accept a resumed call with count<=0 ("everything
+// from here on") after a cursor carrying a non-zero offset, since a bare
+// OFFSET with no LIMIT is a SQL syntax error on sqlite3 and MySQL.
+func TestQueryStructuredResumeWithZeroCount(t *testing.T) {
+	if err := Open(Config{Memory: true}); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if _, _, err := Exec("CREATE TABLE query_resume_t (id INTEGER PRIMARY KEY, v TEXT)", nil); err != nil {
+		t.Fatalf("create table: %v", err)
+	}
+	for i := 0; i < 5; i++ {
+		if _, _, err := Exec("INSERT INTO query_resume_t (v) VALUES ('x')", nil); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+	}
+
+	first, cursor, err := QueryStructured("SELECT id, v FROM query_resume_t ORDER BY id", "", nil, true, 2, "", false)
+	if err != nil {
+		t.Fatalf("first page: %v", err)
+	}
+	if len(first) != 2 || cursor == "" {
+		t.Fatalf("expected a 2-row first page with a cursor, got %d rows, cursor %q", len(first), cursor)
+	}
+
+	rest, _, err := QueryStructured("SELECT id, v FROM query_resume_t ORDER BY id", "", nil, true, 0, cursor, false)
+	if err != nil {
+		t.Fatalf("resume with count=0: %v", err)
+	}
+	if len(rest) != 3 {
+		t.Fatalf("expected 3 remaining rows, got %d", len(rest))
+	}
+}
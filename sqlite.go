@@ -3,61 +3,204 @@ package redisqlite
 import "C"
 import (
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"strconv"
-
-	// sqlite database driver
-	_ "github.com/mattn/go-sqlite3"
+	"strings"
+	"sync"
+	"time"
 )
 
-// database access
-var db *sql.DB
+// database access: rwDB handles Exec (and any SELECT routed through it by
+// a transaction, added later), roDB handles Query. Splitting the two pools
+// lets long-running reads run under WAL without blocking writers.
+var rwDB *sql.DB
+var roDB *sql.DB
+
+// dialect of the currently open database, selected by Open based on
+// Config.Driver
+var dbDialect dialect
+
+// dbMutex guards rwDB, roDB and dbDialect against Restore's close-and-reopen
+// happening concurrently with Exec/Query/Prep/Begin. Readers (every normal
+// query path) take RLock; Open and Restore, which replace the pools and
+// dialect out from under them, take the full Lock.
+var dbMutex sync.RWMutex
+
+// currentDriver, currentDSN and currentConfig remember the settings Open
+// was last called with, so Restore can close and reopen the database with
+// the same configuration.
+var currentDriver string
+var currentDSN string
+var currentConfig Config
 
-// prepared statement cache
-const PREP_MAX_SIZE = 10000
+// Config describes which database Open should connect to.
+type Config struct {
+	// Driver is the name of the registered database/sql driver to use:
+	// "sqlite3" (the default), "postgres" or "mysql". The postgres and
+	// mysql drivers are only linked in when built with the matching
+	// build tag (see driver_postgres.go, driver_mysql.go).
+	Driver string
+	// DSN is the data source name passed to sql.Open for the read-write
+	// pool. Ignored when Memory is true. The read-only pool is derived
+	// from it via the dialect's roDSN (e.g. appending "?mode=ro" for
+	// sqlite3).
+	DSN string
+	// Memory opens an in-memory sqlite database instead of DSN. Only
+	// meaningful when Driver is "sqlite3" or empty.
+	Memory bool
 
-var prep_index uint64 = 1
-var prep_cache map[uint64]*sql.Stmt
+	// MaxOpenConns, MaxIdleConns and ConnMaxIdleTime configure both the
+	// read-write and read-only pools, same as the matching *sql.DB
+	// setters. Zero means "leave the database/sql default". With Memory on
+	// sqlite3, rwDB ignores them and is pinned to one open connection.
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxIdleTime time.Duration
 
-// Open opens the sqlite database
-func Open() (err error) {
-	db, err = sql.Open("sqlite3", "./sqlite.db")
-	prep_cache = make(map[uint64]*sql.Stmt)
-	return err
+	// DumpEvery, if non-zero, starts a background goroutine that writes
+	// a full backup to DumpFile on this interval (see Dump).
+	DumpEvery time.Duration
+	// DumpFile is the destination path for the periodic dump enabled by
+	// DumpEvery.
+	DumpFile string
+}
+
+// Open opens the database described by cfg. An empty cfg.Driver defaults
+// to "sqlite3", with cfg.DSN defaulting to "./sqlite.db" (or replaced by the
+// shared-cache "file::memory:?cache=shared" if cfg.Memory is set).
+func Open(cfg Config) error {
+	dbMutex.Lock()
+	defer dbMutex.Unlock()
+	return openLocked(cfg)
+}
+
+// openLocked does the actual work of Open. Callers must hold dbMutex for
+// write; Restore calls this directly (instead of Open) since it already
+// holds the lock across its close-and-reopen.
+func openLocked(cfg Config) (err error) {
+	driver := cfg.Driver
+	if driver == "" {
+		driver = "sqlite3"
+	}
+
+	dsn := cfg.DSN
+	sqlite3Memory := cfg.Memory && strings.HasPrefix(driver, "sqlite3")
+	if strings.HasPrefix(driver, "sqlite3") {
+		if sqlite3Memory {
+			// a plain ":memory:" DSN gives every *sql.DB connection its
+			// own private database; "cache=shared" is needed so rwDB and
+			// roDB (and every pooled connection within each) see the
+			// same one.
+			dsn = "file::memory:?cache=shared"
+		} else if dsn == "" {
+			dsn = "./sqlite.db"
+		}
+	}
+	dbDialect = dialectFor(driver)
+
+	rwDB, err = sql.Open(driver, dsn)
+	if err != nil {
+		return err
+	}
+	roDB, err = sql.Open(driver, dbDialect.roDSN(dsn))
+	if err != nil {
+		return err
+	}
+
+	for _, pool := range []*sql.DB{rwDB, roDB} {
+		pool.SetMaxOpenConns(cfg.MaxOpenConns)
+		if cfg.MaxIdleConns > 0 {
+			pool.SetMaxIdleConns(cfg.MaxIdleConns)
+		}
+		pool.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+	}
+	if sqlite3Memory {
+		// a shared-cache in-memory database is dropped once its last
+		// connection closes, so rwDB must always keep exactly one open.
+		rwDB.SetMaxOpenConns(1)
+		rwDB.SetMaxIdleConns(1)
+		rwDB.SetConnMaxIdleTime(0)
+
+		// sql.Open never actually dials anything; both pools only create
+		// the shared-cache database on their first real connection. Force
+		// that to happen on rwDB now, before any client call has a chance
+		// to reach roDB first and create it under a read-only connection,
+		// which would leave every later Exec failing with "attempt to
+		// write a readonly database".
+		if err := rwDB.Ping(); err != nil {
+			return err
+		}
+	}
+
+	resetPrepCache()
+
+	hookRegistry.mu.Lock()
+	activeHook = hookRegistry.m[driver]
+	hookRegistry.mu.Unlock()
+
+	currentDriver = driver
+	currentDSN = dsn
+	currentConfig = cfg
+
+	stopPeriodicDump()
+	if cfg.DumpEvery > 0 && cfg.DumpFile != "" {
+		startPeriodicDump(cfg.DumpEvery, cfg.DumpFile)
+	}
+
+	return nil
+}
+
+// isSelect reports whether stmt looks like a read-only query, used to
+// decide which pool should prepare and serve it.
+func isSelect(stmt string) bool {
+	return strings.HasPrefix(strings.ToUpper(strings.TrimSpace(stmt)), "SELECT")
 }
 
 // Exec execute a statement applying an array of arguments,
 // returns the number of affected rows and the last id modified, when applicable
+// an argument may be a plain Go value or an Arg, for binary-safe binding
 func Exec(stmtOrNumber string, args []interface{}) (count int64, lastId int64, err error) {
 	var res sql.Result
+	args = bindArgs(args)
+	start := time.Now()
+	var execErr error
+	defer func() { recordExec(time.Since(start), execErr) }()
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
+
 	// select number or string
-	index, err := strconv.ParseUint(stmtOrNumber, 10, 64)
-	if err == nil {
-		stmt := prep_cache[index]
-		if stmt == nil {
-			return -1, -1, errors.New("no such prepared statement index")
+	index, perr := strconv.ParseUint(stmtOrNumber, 10, 64)
+	if perr == nil {
+		prepared, ok := lookupPrep(index)
+		if !ok {
+			execErr = errors.New("no such prepared statement index")
+			return -1, -1, execErr
 		}
-		res, err = stmt.Exec(args...)
-		if err != nil {
-			return -1, -1, err
+		res, execErr = prepared.stmt.Exec(args...)
+		if execErr != nil {
+			return -1, -1, execErr
 		}
 	} else {
-		res, err = db.Exec(stmtOrNumber, args...)
-		if err != nil {
-			return -1, -1, err
+		res, execErr = rwDB.Exec(stmtOrNumber, args...)
+		if execErr != nil {
+			return -1, -1, execErr
 		}
 	}
 
-	count, err = res.RowsAffected()
-	if err != nil {
+	count, countErr := res.RowsAffected()
+	if countErr != nil {
 		count = -1
 	}
-	lastId, err = res.LastInsertId()
+	// lastInsertId's error (e.g. ErrLastInsertIdUnsupported on dialects with
+	// no such concept) is propagated rather than silently folded into -1, so
+	// a caller that actually needs the id can tell "unsupported" apart from
+	// "zero rows inserted".
+	lastId, err = dbDialect.lastInsertId(res)
 	if err != nil {
 		lastId = -1
 	}
-	return lastId, count, nil
+	return lastId, count, err
 }
 
 // Query execute a query applying an array of args
@@ -65,30 +208,48 @@ func Exec(stmtOrNumber string, args []interface{}) (count int64, lastId int64, e
 // if it is a number then it will execute a prepared statement idenfied by the number returned by Prep
 // returns an array of results, either as an array of maps or as an array of arrays
 // according the `asMap` parameters, and returns up to `count` results (0 for everything)
-func Query(queryOrNumber string, args []interface{}, asMap bool, count int64) (res []string, err error) {
+// an argument may be a plain Go value or an Arg, for binary-safe binding
+// results are JSON-encoded unless asBinary is set, in which case they are
+// MessagePack-encoded, which round-trips BLOB columns without the
+// inconsistent base64-ing encoding/json applies to []byte values
+func Query(queryOrNumber string, args []interface{}, asMap bool, count int64, asBinary bool) (res []string, err error) {
 	// execute a query
 	var rows *sql.Rows
+	args = bindArgs(args)
+	start := time.Now()
+	defer func() { recordQuery(time.Since(start), err) }()
+
+	dbMutex.RLock()
+	defer dbMutex.RUnlock()
 
 	// grab cached stmp
 	index, err := strconv.ParseUint(queryOrNumber, 10, 64)
 	if err == nil {
-		stmt := prep_cache[index]
-		if stmt == nil {
+		prepared, ok := lookupPrep(index)
+		if !ok {
 			return nil, errors.New("no such prepared statement index")
 		}
-		rows, err = stmt.Query(args...)
+		rows, err = prepared.stmt.Query(args...)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
 	} else {
-		rows, err = db.Query(queryOrNumber, args...)
+		rows, err = roDB.Query(queryOrNumber, args...)
 		if err != nil {
 			return nil, err
 		}
 		defer rows.Close()
 	}
 
+	return scanRows(rows, asMap, count, asBinary)
+}
+
+// scanRows drains rows into the same []string encoding Query documents,
+// either as JSON or MessagePack maps or arrays depending on asMap and
+// asBinary, stopping after count rows (0 for everything). Shared by Query,
+// QueryTx and QueryStructured.
+func scanRows(rows *sql.Rows, asMap bool, count int64, asBinary bool) (res []string, err error) {
 	// prepare output
 	out := make([]string, 0)
 	columns, err := rows.Columns()
@@ -116,7 +277,7 @@ func Query(queryOrNumber string, args []interface{}, asMap bool, count int64) (r
 				record[columns[i]] = v
 			}
 			// serialize record
-			bytes, err = json.Marshal(record)
+			bytes, err = encodeRecord(record, asBinary)
 			if err != nil {
 				continue
 			}
@@ -126,7 +287,7 @@ func Query(queryOrNumber string, args []interface{}, asMap bool, count int64) (r
 			array = append(array, values...)
 
 			// serialize record
-			bytes, err = json.Marshal(array)
+			bytes, err = encodeRecord(array, asBinary)
 			if err != nil {
 				continue
 			}
@@ -142,49 +303,3 @@ func Query(queryOrNumber string, args []interface{}, asMap bool, count int64) (r
 	}
 	return out, rows.Err()
 }
-
-// Prep accepts prepares a sql statement and stores it in a table
-// returning a number. It also accepts a number, and if it corresponds
-// to the number returned by a previous statement, it closes the prepared statement
-// you can store up to one 10000 statements, if you go over the limit it will return an error
-// using the special statement "clean_prep_cache" you can close all the opened statement
-// returnend 0 means OK, any other number is the index in the cache
-func Prep(queryOrNumber string) (uint64, error) {
-
-	if queryOrNumber == "clean_prep_cache" {
-		for key, value := range prep_cache {
-			value.Close()
-			delete(prep_cache, key)
-		}
-		return 0, nil
-	}
-
-	index, err := strconv.ParseUint(queryOrNumber, 10, 64)
-	if err == nil {
-		// clean all
-		stat, ok := prep_cache[index]
-		if ok {
-			stat.Close()
-			delete(prep_cache, index)
-			return 0, nil
-		}
-		return 0, errors.New("invalid prepared statement index")
-	}
-
-	if len(prep_cache) >= PREP_MAX_SIZE {
-		return 0, errors.New("too many prepared statements, use clean_prep_cache on prep to clean")
-	}
-
-	// get next index and close very old statements if still unclosed
-	prep_index = prep_index + 1
-	// handle unlikely case of overflow
-	if prep_index == 0 {
-		prep_index = 1
-	}
-	stmt, err := db.Prepare(queryOrNumber)
-	if err != nil {
-		return 0, err
-	}
-	prep_cache[prep_index] = stmt
-	return prep_index, nil
-}
@@ -0,0 +1,36 @@
+package redisqlite
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// Open must apply MaxOpenConns to both the read-write and read-only pools.
+// A file DSN is used rather than Config.Memory, which pins rwDB to a single
+// connection regardless of MaxOpenConns.
+func TestOpenConfiguresBothPools(t *testing.T) {
+	cfg := Config{DSN: filepath.Join(t.TempDir(), "pools.db"), MaxOpenConns: 4, MaxIdleConns: 2}
+	if err := Open(cfg); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	if rwStats := rwDB.Stats(); rwStats.MaxOpenConnections != 4 {
+		t.Fatalf("expected rwDB MaxOpenConns to be 4, got %d", rwStats.MaxOpenConnections)
+	}
+	stats := roDB.Stats()
+	if stats.MaxOpenConnections != 4 {
+		t.Fatalf("expected roDB MaxOpenConns to be 4, got %d", stats.MaxOpenConnections)
+	}
+}
+
+func TestSqliteDialectRoDSNAppendsModeRo(t *testing.T) {
+	got := sqliteDialect{}.roDSN("./sqlite.db")
+	if got != "./sqlite.db?mode=ro&_journal=WAL" {
+		t.Fatalf("got %q", got)
+	}
+
+	got = sqliteDialect{}.roDSN("./sqlite.db?cache=shared")
+	if got != "./sqlite.db?cache=shared&mode=ro&_journal=WAL" {
+		t.Fatalf("got %q", got)
+	}
+}
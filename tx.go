@@ -0,0 +1,201 @@
+package redisqlite
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// TxIdleTimeout is how long an open transaction may go without an
+// ExecTx/QueryTx/Commit/Rollback call before the reaper rolls it back, so a
+// transaction abandoned by a disconnected client doesn't hold locks forever.
+const TxIdleTimeout = 30 * time.Second
+
+// txReapInterval is how often the reaper sweeps tx_cache for idle
+// transactions.
+const txReapInterval = 10 * time.Second
+
+// txSession is a session entry, similar in spirit to prep_cache's entries
+// but keyed on its own index space since a transaction and a prepared
+// statement are never interchangeable.
+type txSession struct {
+	tx       *sql.Tx
+	lastUsed time.Time
+}
+
+var tx_mutex sync.Mutex
+var tx_index uint64 = 1
+var tx_cache = make(map[uint64]*txSession)
+var tx_reaper_once sync.Once
+
+// Begin starts a new transaction on the read-write pool and returns a
+// handle to pass to ExecTx, QueryTx, Commit or Rollback.
+func Begin() (uint64, error) {
+	dbMutex.RLock()
+	tx, err := rwDB.Begin()
+	dbMutex.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+
+	tx_reaper_once.Do(startTxReaper)
+
+	tx_mutex.Lock()
+	defer tx_mutex.Unlock()
+
+	tx_index = tx_index + 1
+	// handle unlikely case of overflow
+	if tx_index == 0 {
+		tx_index = 1
+	}
+	tx_cache[tx_index] = &txSession{tx: tx, lastUsed: time.Now()}
+	Stats.Add("tx_open", 1)
+	return tx_index, nil
+}
+
+// Commit commits the transaction identified by txId.
+func Commit(txId uint64) error {
+	session, err := takeTx(txId)
+	if err != nil {
+		return err
+	}
+	return session.tx.Commit()
+}
+
+// Rollback rolls back the transaction identified by txId.
+func Rollback(txId uint64) error {
+	session, err := takeTx(txId)
+	if err != nil {
+		return err
+	}
+	return session.tx.Rollback()
+}
+
+// ExecTx is Exec scoped to the transaction identified by txId.
+func ExecTx(txId uint64, stmtOrNumber string, args []interface{}) (count int64, lastId int64, err error) {
+	session, err := touchTx(txId)
+	if err != nil {
+		return -1, -1, err
+	}
+
+	args = bindArgs(args)
+	var res sql.Result
+	index, perr := strconv.ParseUint(stmtOrNumber, 10, 64)
+	if perr == nil {
+		prepared, ok := lookupPrep(index)
+		if !ok {
+			return -1, -1, errors.New("no such prepared statement index")
+		}
+		res, err = session.tx.Stmt(prepared.stmt).Exec(args...)
+	} else {
+		res, err = session.tx.Exec(stmtOrNumber, args...)
+	}
+	if err != nil {
+		return -1, -1, err
+	}
+
+	count, countErr := res.RowsAffected()
+	if countErr != nil {
+		count = -1
+	}
+	// lastInsertId's error (e.g. ErrLastInsertIdUnsupported) is propagated
+	// rather than silently folded into -1, same as Exec.
+	dbMutex.RLock()
+	lastId, err = dbDialect.lastInsertId(res)
+	dbMutex.RUnlock()
+	if err != nil {
+		lastId = -1
+	}
+	return lastId, count, err
+}
+
+// QueryTx is Query scoped to the transaction identified by txId.
+func QueryTx(txId uint64, queryOrNumber string, args []interface{}, asMap bool, count int64, asBinary bool) (res []string, err error) {
+	session, err := touchTx(txId)
+	if err != nil {
+		return nil, err
+	}
+
+	args = bindArgs(args)
+	var rows *sql.Rows
+	index, perr := strconv.ParseUint(queryOrNumber, 10, 64)
+	if perr == nil {
+		prepared, ok := lookupPrep(index)
+		if !ok {
+			return nil, errors.New("no such prepared statement index")
+		}
+		rows, err = session.tx.Stmt(prepared.stmt).Query(args...)
+	} else {
+		rows, err = session.tx.Query(queryOrNumber, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRows(rows, asMap, count, asBinary)
+}
+
+// takeTx removes and returns the session for txId, so Commit/Rollback
+// can't be called twice on the same handle.
+func takeTx(txId uint64) (*txSession, error) {
+	tx_mutex.Lock()
+	defer tx_mutex.Unlock()
+
+	session, ok := tx_cache[txId]
+	if !ok {
+		return nil, errors.New("no such transaction")
+	}
+	delete(tx_cache, txId)
+	Stats.Add("tx_open", -1)
+	return session, nil
+}
+
+// touchTx fetches the session for txId and bumps its idle deadline.
+func touchTx(txId uint64) (*txSession, error) {
+	tx_mutex.Lock()
+	defer tx_mutex.Unlock()
+
+	session, ok := tx_cache[txId]
+	if !ok {
+		return nil, errors.New("no such transaction")
+	}
+	session.lastUsed = time.Now()
+	return session, nil
+}
+
+// startTxReaper rolls back transactions that have been idle for longer
+// than TxIdleTimeout, so a client that disconnects mid-transaction doesn't
+// hold locks forever.
+func startTxReaper() {
+	go func() {
+		ticker := time.NewTicker(txReapInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			reapIdleTx()
+		}
+	}()
+}
+
+func reapIdleTx() {
+	now := time.Now()
+
+	tx_mutex.Lock()
+	var stale []*txSession
+	for id, session := range tx_cache {
+		if now.Sub(session.lastUsed) > TxIdleTimeout {
+			stale = append(stale, session)
+			delete(tx_cache, id)
+		}
+	}
+	tx_mutex.Unlock()
+	if len(stale) > 0 {
+		Stats.Add("tx_open", int64(-len(stale)))
+	}
+
+	for _, session := range stale {
+		_ = session.tx.Rollback()
+	}
+}
@@ -0,0 +1,44 @@
+package redisqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// reapIdleTx must roll back and evict only sessions idle past
+// TxIdleTimeout, leaving recently-touched ones alone.
+func TestReapIdleTx(t *testing.T) {
+	// A real file, not Config.Memory, since an in-memory pool is pinned to
+	// a single connection and two concurrently open transactions need two.
+	dsn := filepath.Join(t.TempDir(), "reap.db")
+	if err := Open(Config{DSN: dsn}); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	staleId, err := Begin()
+	if err != nil {
+		t.Fatalf("Begin (stale): %v", err)
+	}
+	freshId, err := Begin()
+	if err != nil {
+		t.Fatalf("Begin (fresh): %v", err)
+	}
+
+	tx_mutex.Lock()
+	tx_cache[staleId].lastUsed = time.Now().Add(-2 * TxIdleTimeout)
+	tx_mutex.Unlock()
+
+	reapIdleTx()
+
+	if _, err := touchTx(staleId); err == nil {
+		t.Fatalf("expected the stale transaction to have been reaped")
+	}
+	if _, err := touchTx(freshId); err != nil {
+		t.Fatalf("expected the fresh transaction to survive, got %v", err)
+	}
+
+	if err := Rollback(freshId); err != nil {
+		t.Fatalf("Rollback fresh: %v", err)
+	}
+}